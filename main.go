@@ -1,34 +1,61 @@
 package main
 
 import (
-	"github.com/yunnet/chillon/server"
+	"flag"
 	"log"
 	"os"
+
+	"github.com/yunnet/chillon/server"
+	"github.com/yunnet/chillon/server/driver/file"
+	"github.com/yunnet/chillon/server/driver/minio"
 )
 
 func main() {
 	logfile, err := os.Create("chillon.log")
-	if err != nil{
+	if err != nil {
 		log.Fatal("fail to create chillon.log file.")
 	}
 	logger := log.New(logfile, "", log.Llongfile)
 
-
-	upload := "./upload"
-	listenPort := 2121
-
-	_, err = os.Stat(upload)
-	if os.IsNotExist(err){
-		os.MkdirAll(upload, os.ModePerm)
-	}
+	driverName := flag.String("driver", "file", "storage driver to use: file|minio")
+	upload := flag.String("root", "./upload", "root path served by the file driver")
+	minioEndpoint := flag.String("minio-endpoint", "", "minio/S3 endpoint, e.g. play.min.io")
+	minioBucket := flag.String("minio-bucket", "", "minio/S3 bucket to serve")
+	minioAccessKey := flag.String("minio-access-key", "", "minio/S3 access key")
+	minioSecretKey := flag.String("minio-secret-key", "", "minio/S3 secret key")
+	minioUseSSL := flag.Bool("minio-use-ssl", true, "use TLS when talking to the minio/S3 endpoint")
+	listenPort := flag.Int("port", 2121, "port to listen on")
+	flag.Parse()
 
 	perm := server.NewSimplePerm("root", "root")
-	factory := &server.FileDriverFactory{
-		RootPath: upload,
-		Perm:     perm,
+
+	var factory server.DriverFactory
+	switch *driverName {
+	case "minio":
+		factory = &minio.DriverFactory{
+			Config: minio.Config{
+				Endpoint:        *minioEndpoint,
+				Bucket:          *minioBucket,
+				AccessKeyID:     *minioAccessKey,
+				SecretAccessKey: *minioSecretKey,
+				UseSSL:          *minioUseSSL,
+			},
+			Perm: perm,
+		}
+	case "file":
+		_, err = os.Stat(*upload)
+		if os.IsNotExist(err) {
+			os.MkdirAll(*upload, os.ModePerm)
+		}
+		factory = &file.DriverFactory{
+			RootPath: *upload,
+			Perm:     perm,
+		}
+	default:
+		logger.Fatal("unknown -driver: ", *driverName)
 	}
 
-	auth := &server.SimpleAuth{Name:"admin", Password:"123456"}
+	auth := &server.SimpleAuth{Name: "admin", Password: "123456"}
 
 	opt := &server.ServerOpts{
 		Factory:        factory,
@@ -37,7 +64,7 @@ func main() {
 		Hostname:       "",
 		PublicIp:       "",
 		PassivePorts:   "",
-		Port:           listenPort,
+		Port:           *listenPort,
 		TLS:            false,
 		CertFile:       "",
 		KeyFile:        "",
@@ -47,9 +74,9 @@ func main() {
 	}
 	ftpserver := server.NewServer(opt)
 
-	logger.Println("FTP Server start...", 2121)
+	logger.Println("FTP Server start...", *listenPort)
 
-	if err := ftpserver.ListenAndServe(); err != nil{
+	if err := ftpserver.ListenAndServe(); err != nil {
 		logger.Fatal("Error starting server: ", err)
 	}
 }
@@ -0,0 +1,212 @@
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// BwLimiter is an optional interface a Driver can implement to cap its own
+// session's transfer rate, in bytes/sec, overriding ServerOpts.BwLimit for
+// that one connection. Since a Driver instance already belongs to a single
+// session (see ProxyDriverFactory), no user parameter is needed - a limit
+// of 0 means "use ServerOpts.BwLimit instead".
+type BwLimiter interface {
+	BwLimit() int64
+}
+
+// SessionStats is a point-in-time snapshot of one session's transfer
+// accounting, as returned by Server.Stats().
+type SessionStats struct {
+	SessionID    string
+	BytesIn      int64
+	BytesOut     int64
+	StartedAt    time.Time
+	LastActiveAt time.Time
+}
+
+// Throughput returns the session's average bytes/sec, in+out combined,
+// over its lifetime so far.
+func (s SessionStats) Throughput() float64 {
+	elapsed := s.LastActiveAt.Sub(s.StartedAt).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.BytesIn+s.BytesOut) / elapsed
+}
+
+// accounting tracks bytes transferred for one session and, when a limit is
+// set, rate-limits it with a token bucket.
+type accounting struct {
+	sessionID string
+	startedAt time.Time
+
+	mu         sync.Mutex
+	bytesIn    int64
+	bytesOut   int64
+	lastActive time.Time
+	limiter    *rate.Limiter
+}
+
+func newAccounting(sessionID string, bytesPerSec int64) *accounting {
+	now := time.Now()
+	a := &accounting{sessionID: sessionID, startedAt: now, lastActive: now}
+	a.setLimit(bytesPerSec)
+	return a
+}
+
+// setLimit replaces the token bucket with one allowing bytesPerSec; 0 (or
+// negative) means unlimited.
+func (a *accounting) setLimit(bytesPerSec int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if bytesPerSec <= 0 {
+		a.limiter = nil
+		return
+	}
+	a.limiter = rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))
+}
+
+func (a *accounting) snapshot() SessionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return SessionStats{
+		SessionID:    a.sessionID,
+		BytesIn:      a.bytesIn,
+		BytesOut:     a.bytesOut,
+		StartedAt:    a.startedAt,
+		LastActiveAt: a.lastActive,
+	}
+}
+
+func (a *accounting) record(n int, out bool) {
+	a.mu.Lock()
+	if out {
+		a.bytesOut += int64(n)
+	} else {
+		a.bytesIn += int64(n)
+	}
+	a.lastActive = time.Now()
+	a.mu.Unlock()
+}
+
+// throttle blocks until n bytes are allowed through the token bucket, if
+// one is set. WaitN refuses requests bigger than the bucket itself, so a
+// large Read/Write is split into burst-sized chunks.
+func (a *accounting) throttle(n int) error {
+	a.mu.Lock()
+	limiter := a.limiter
+	a.mu.Unlock()
+	if limiter == nil || n <= 0 {
+		return nil
+	}
+
+	burst := limiter.Burst()
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		if err := limiter.WaitN(context.Background(), chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// accountingReader wraps the data-connection reader passed to or returned
+// from Driver.PutFile/GetFile, rate-limiting it against accounting's token
+// bucket and recording bytes as they're read.
+type accountingReader struct {
+	r   io.Reader
+	a   *accounting
+	out bool // true: bytes read are being sent to the client (GetFile); false: received from the client (PutFile)
+}
+
+func (r *accountingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if tErr := r.a.throttle(n); tErr != nil {
+			return n, tErr
+		}
+		r.a.record(n, r.out)
+	}
+	return n, err
+}
+
+func (r *accountingReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// accounting returns (creating if necessary) the bandwidth accounting for
+// c's session, picking up any per-driver override of ServerOpts.BwLimit.
+func (c *Conn) accounting() *accounting {
+	a := c.server.accountingFor(c.sessionID)
+	if limiter, ok := c.driver.(BwLimiter); ok {
+		if limit := limiter.BwLimit(); limit > 0 {
+			a.setLimit(limit)
+		}
+	}
+	return a
+}
+
+// WrapUpload wraps data - the reader a STOR-family command is about to pass
+// to Driver.PutFile - with this session's bandwidth accounting. It's meant
+// to be called from that command handler, which isn't part of this tree;
+// nothing calls it yet.
+func (c *Conn) WrapUpload(data io.Reader) io.Reader {
+	return &accountingReader{r: data, a: c.accounting(), out: false}
+}
+
+// WrapDownload wraps r - the io.ReadCloser a RETR-family command got back
+// from Driver.GetFile - with this session's bandwidth accounting. It's
+// meant to be called from that command handler, which isn't part of this
+// tree; nothing calls it yet.
+func (c *Conn) WrapDownload(r io.ReadCloser) io.ReadCloser {
+	return &accountingReader{r: r, a: c.accounting(), out: true}
+}
+
+func (s *Server) accountingFor(sessionID string) *accounting {
+	s.bwAccMu.Lock()
+	defer s.bwAccMu.Unlock()
+	if s.bwAcc == nil {
+		s.bwAcc = map[string]*accounting{}
+	}
+	a, ok := s.bwAcc[sessionID]
+	if !ok {
+		a = newAccounting(sessionID, s.ServerOpts.BwLimit)
+		s.bwAcc[sessionID] = a
+	}
+	return a
+}
+
+// endAccounting drops sessionID's accounting; it's called once the
+// connection it belongs to closes.
+func (s *Server) endAccounting(sessionID string) {
+	s.bwAccMu.Lock()
+	delete(s.bwAcc, sessionID)
+	s.bwAccMu.Unlock()
+}
+
+// Stats returns a snapshot of every session that has transferred data since
+// it connected, for monitoring.
+func (s *Server) Stats() []SessionStats {
+	s.bwAccMu.Lock()
+	defer s.bwAccMu.Unlock()
+	stats := make([]SessionStats, 0, len(s.bwAcc))
+	for _, a := range s.bwAcc {
+		stats = append(stats, a.snapshot())
+	}
+	return stats
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestAccountingRecordAndSnapshot(t *testing.T) {
+	a := newAccounting("sess-1", 0)
+	a.record(10, false)
+	a.record(20, true)
+
+	stats := a.snapshot()
+	if stats.SessionID != "sess-1" {
+		t.Fatalf("SessionID = %q, want sess-1", stats.SessionID)
+	}
+	if stats.BytesIn != 10 || stats.BytesOut != 20 {
+		t.Fatalf("BytesIn/Out = %d/%d, want 10/20", stats.BytesIn, stats.BytesOut)
+	}
+}
+
+func TestSessionStatsThroughput(t *testing.T) {
+	now := time.Now()
+	stats := SessionStats{BytesIn: 50, BytesOut: 50, StartedAt: now, LastActiveAt: now.Add(time.Second)}
+	if got := stats.Throughput(); got != 100 {
+		t.Fatalf("Throughput = %v, want 100", got)
+	}
+
+	zero := SessionStats{StartedAt: now, LastActiveAt: now}
+	if got := zero.Throughput(); got != 0 {
+		t.Fatalf("Throughput with no elapsed time = %v, want 0", got)
+	}
+}
+
+func TestAccountingThrottleUnlimitedIsNoop(t *testing.T) {
+	a := newAccounting("sess-2", 0)
+	if err := a.throttle(1 << 20); err != nil {
+		t.Fatalf("throttle with no limit: %v", err)
+	}
+}
+
+func TestAccountingThrottleSplitsAboveBurst(t *testing.T) {
+	a := newAccounting("sess-3", 100)
+
+	start := time.Now()
+	// Burst equals the configured rate (100 bytes/sec), so asking for 300
+	// bytes must wait for the bucket to refill across more than one burst.
+	if err := a.throttle(300); err != nil {
+		t.Fatalf("throttle: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("throttle(300) over a 100 B/s limit returned after %v, want >= 1s", elapsed)
+	}
+}
+
+func TestAccountingSetLimitDisables(t *testing.T) {
+	a := newAccounting("sess-4", 100)
+	a.setLimit(0)
+	start := time.Now()
+	if err := a.throttle(1 << 20); err != nil {
+		t.Fatalf("throttle: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("throttle after setLimit(0) took %v, want effectively instant", elapsed)
+	}
+}
+
+func TestAccountingReaderRecordsBytes(t *testing.T) {
+	a := newAccounting("sess-5", 0)
+	r := &accountingReader{r: bytes.NewBufferString("hello world"), a: a, out: true}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "hello world" {
+		t.Fatalf("data = %q", got)
+	}
+
+	stats := a.snapshot()
+	if stats.BytesOut != int64(len("hello world")) {
+		t.Fatalf("BytesOut = %d, want %d", stats.BytesOut, len("hello world"))
+	}
+	if stats.BytesIn != 0 {
+		t.Fatalf("BytesIn = %d, want 0", stats.BytesIn)
+	}
+}
+
+func TestAccountingReaderClosePassthrough(t *testing.T) {
+	closed := false
+	r := &accountingReader{r: closerFunc{Reader: bytes.NewBufferString(""), closeFn: func() error { closed = true; return nil }}}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !closed {
+		t.Fatal("Close did not reach the underlying closer")
+	}
+}
+
+type closerFunc struct {
+	io.Reader
+	closeFn func() error
+}
+
+func (c closerFunc) Close() error { return c.closeFn() }
@@ -0,0 +1,144 @@
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AdminHandler exposes a small JSON API for managing the users and ACLs
+// stored in an LDBAuth/LDBPerm pair, so operators can add accounts or
+// change permissions without restarting the FTP server. Mount it on a side
+// port, separate from the FTP listener itself:
+//
+//     admin := server.NewAdminHandler(auth, perm, token)
+//     go http.ListenAndServe(":2122", admin)
+//
+// Every request must carry "Authorization: Bearer <Token>"; requests
+// without a matching token are rejected before touching Auth or Perm.
+type AdminHandler struct {
+	Auth  *LDBAuth
+	Perm  *LDBPerm
+	Token string
+}
+
+// NewAdminHandler returns an AdminHandler managing auth and perm, requiring
+// token on every request. token must be non-empty.
+func NewAdminHandler(auth *LDBAuth, perm *LDBPerm, token string) *AdminHandler {
+	return &AdminHandler{Auth: auth, Perm: perm, Token: token}
+}
+
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	got := r.Header.Get("Authorization")
+	if !strings.HasPrefix(got, prefix) {
+		return false
+	}
+	got = strings.TrimPrefix(got, prefix)
+	return h.Token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(h.Token)) == 1
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/users" && r.Method == http.MethodPost:
+		h.putUser(w, r)
+	case strings.HasPrefix(r.URL.Path, "/users/") && r.Method == http.MethodDelete:
+		h.deleteUser(w, r)
+	case r.URL.Path == "/acl" && r.Method == http.MethodPost:
+		h.setACL(w, r)
+	case strings.HasPrefix(r.URL.Path, "/acl/") && r.Method == http.MethodDelete:
+		h.deleteACL(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type putUserRequest struct {
+	Name    string `json:"name"`
+	Pass    string `json:"pass"`
+	HomeDir string `json:"home_dir"`
+}
+
+func (h *AdminHandler) putUser(w http.ResponseWriter, r *http.Request) {
+	var req putUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.Auth.PutUser(req.Name, req.Pass, req.HomeDir); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/users/")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.Auth.DeleteUser(name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type setACLRequest struct {
+	Path  string `json:"path"`
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+	Mode  string `json:"mode"`
+}
+
+func (h *AdminHandler) setACL(w http.ResponseWriter, r *http.Request) {
+	var req setACLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	mode, err := strconv.ParseUint(req.Mode, 8, 32)
+	if err != nil {
+		http.Error(w, "mode must be an octal file mode, e.g. \"0755\"", http.StatusBadRequest)
+		return
+	}
+	if err := h.Perm.SetACL(req.Path, req.Owner, req.Group, os.FileMode(mode)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) deleteACL(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/acl/")
+	if path == "" {
+		http.Error(w, "path is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.Perm.DeleteACL(path); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func newTestAdminHandler(t *testing.T) *AdminHandler {
+	t.Helper()
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatalf("leveldb.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewAdminHandler(NewLDBAuth(db), NewLDBPerm(db, "root", "root"), "s3cret")
+}
+
+func TestAdminHandlerRejectsMissingOrWrongToken(t *testing.T) {
+	h := newTestAdminHandler(t)
+
+	cases := []string{"", "Bearer wrong", "s3cret"}
+	for _, authHeader := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"alice"}`))
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization=%q: status = %d, want %d", authHeader, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestAdminHandlerAcceptsCorrectToken(t *testing.T) {
+	h := newTestAdminHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"alice","pass":"hunter2","home_dir":"/alice"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+
+	home, err := h.Auth.HomeDir("alice")
+	if err != nil {
+		t.Fatalf("HomeDir: %v", err)
+	}
+	if home != "/alice" {
+		t.Fatalf("HomeDir = %q, want /alice", home)
+	}
+}
@@ -1,5 +1,10 @@
-package server
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
 
+// Package file implements server.Driver on top of the local filesystem.
+// It is the original storage backend and remains the default one.
+package file
 
 import (
 	"encoding/json"
@@ -9,11 +14,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/yunnet/chillon/server"
 )
 
-type FileDriver struct {
+type Driver struct {
 	RootPath string
-	Perm
+	server.Perm
 }
 
 type FileInfoEx struct {
@@ -36,16 +43,16 @@ func (f *FileInfoEx) Group() string {
 	return f.group
 }
 
-func (f *FileDriver) realPath(path string) string {
+func (f *Driver) realPath(path string) string {
 	paths := strings.Split(path, "/")
 	return filepath.Join(append([]string{f.RootPath}, paths...)...)
 }
 
-func (f *FileDriver) Init(conn *Conn) {
+func (f *Driver) Init(conn *server.Conn) {
 	//driver.conn = conn
 }
 
-func (f *FileDriver) ChangeDir(path string) error {
+func (f *Driver) ChangeDir(path string) error {
 	rPath := f.realPath(path)
 	r, err := os.Lstat(rPath)
 	if err != nil {
@@ -57,7 +64,7 @@ func (f *FileDriver) ChangeDir(path string) error {
 	return errors.New("Not a directory")
 }
 
-func (f *FileDriver) Stat(path string) (FileInfo, error) {
+func (f *Driver) Stat(path string) (server.FileInfo, error) {
 	basepath := f.realPath(path)
 	rPath, err := filepath.Abs(basepath)
 	if err != nil {
@@ -70,7 +77,7 @@ func (f *FileDriver) Stat(path string) (FileInfo, error) {
 		return nil, err
 	}
 
-	if jsonStr, err := json.Marshal(r); err == nil{
+	if jsonStr, err := json.Marshal(r); err == nil {
 		fmt.Println("ok file name: " + path)
 		fmt.Println(string(jsonStr))
 	}
@@ -93,7 +100,7 @@ func (f *FileDriver) Stat(path string) (FileInfo, error) {
 	return &FileInfoEx{r, mode, owner, group}, nil
 }
 
-func (c *FileDriver) ListDir(path string, callback func(FileInfo) error) error {
+func (c *Driver) ListDir(path string, callback func(server.FileInfo) error) error {
 	basepath := c.realPath(path)
 	return filepath.Walk(basepath, func(f string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -131,7 +138,7 @@ func (c *FileDriver) ListDir(path string, callback func(FileInfo) error) error {
 	})
 }
 
-func (f *FileDriver) DeleteDir(path string) error {
+func (f *Driver) DeleteDir(path string) error {
 	rPath := f.realPath(path)
 	r, err := os.Lstat(rPath)
 	if err != nil {
@@ -143,7 +150,7 @@ func (f *FileDriver) DeleteDir(path string) error {
 	return errors.New("Not a directory")
 }
 
-func (c *FileDriver) DeleteFile(path string) error {
+func (c *Driver) DeleteFile(path string) error {
 	rPath := c.realPath(path)
 	f, err := os.Lstat(rPath)
 	if err != nil {
@@ -155,18 +162,18 @@ func (c *FileDriver) DeleteFile(path string) error {
 	return errors.New("Not a file")
 }
 
-func (f *FileDriver) Rename(fromPath string, toPath string) error {
+func (f *Driver) Rename(fromPath string, toPath string) error {
 	oldPath := f.realPath(fromPath)
 	newPath := f.realPath(toPath)
 	return os.Rename(oldPath, newPath)
 }
 
-func (f *FileDriver) MakeDir(path string) error {
+func (f *Driver) MakeDir(path string) error {
 	rPath := f.realPath(path)
 	return os.MkdirAll(rPath, os.ModePerm)
 }
 
-func (f *FileDriver) GetFile(path string, offset int64) (int64, io.ReadCloser, error) {
+func (f *Driver) GetFile(path string, offset int64) (int64, io.ReadCloser, error) {
 	rPath := f.realPath(path)
 	r, err := os.Open(rPath)
 	if err != nil {
@@ -183,7 +190,7 @@ func (f *FileDriver) GetFile(path string, offset int64) (int64, io.ReadCloser, e
 	return info.Size(), r, nil
 }
 
-func (f *FileDriver) PutFile(destPath string, data io.Reader, appendData bool) (int64, error) {
+func (f *Driver) PutFile(destPath string, data io.Reader, appendData bool) (int64, error) {
 	rPath := f.realPath(destPath)
 
 	var isExist bool
@@ -243,11 +250,13 @@ func (f *FileDriver) PutFile(destPath string, data io.Reader, appendData bool) (
 	return bytes, nil
 }
 
-type FileDriverFactory struct {
+// DriverFactory builds a Driver rooted at RootPath for each new client
+// connection.
+type DriverFactory struct {
 	RootPath string
-	Perm
+	server.Perm
 }
 
-func (f *FileDriverFactory) NewDriver() (Driver, error) {
-	return &FileDriver{f.RootPath, f.Perm}, nil
+func (f *DriverFactory) NewDriver() (server.Driver, error) {
+	return &Driver{f.RootPath, f.Perm}, nil
 }
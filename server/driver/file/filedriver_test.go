@@ -0,0 +1,176 @@
+package file
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/yunnet/chillon/server"
+)
+
+type stubPerm struct{}
+
+func (stubPerm) GetMode(path string) (os.FileMode, error) { return 0644, nil }
+func (stubPerm) GetOwner(path string) (string, error)     { return "root", nil }
+func (stubPerm) GetGroup(path string) (string, error)     { return "root", nil }
+
+var _ server.Perm = stubPerm{}
+
+func newTestDriver(t *testing.T) *Driver {
+	t.Helper()
+	return &Driver{RootPath: t.TempDir(), Perm: stubPerm{}}
+}
+
+func TestPutFileThenGetFile(t *testing.T) {
+	d := newTestDriver(t)
+
+	if _, err := d.PutFile("/a.txt", bytes.NewBufferString("hello"), false); err != nil {
+		t.Fatalf("PutFile: %v", err)
+	}
+
+	size, r, err := d.GetFile("/a.txt", 0)
+	if err != nil {
+		t.Fatalf("GetFile: %v", err)
+	}
+	defer r.Close()
+	if size != 5 {
+		t.Fatalf("size = %d, want 5", size)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("data = %q, want %q", got, "hello")
+	}
+}
+
+func TestGetFileOffset(t *testing.T) {
+	d := newTestDriver(t)
+	if _, err := d.PutFile("/f", bytes.NewBufferString("0123456789"), false); err != nil {
+		t.Fatalf("PutFile: %v", err)
+	}
+
+	_, r, err := d.GetFile("/f", 5)
+	if err != nil {
+		t.Fatalf("GetFile: %v", err)
+	}
+	defer r.Close()
+	got, _ := ioutil.ReadAll(r)
+	if string(got) != "56789" {
+		t.Fatalf("data = %q, want %q", got, "56789")
+	}
+}
+
+func TestPutFileAppend(t *testing.T) {
+	d := newTestDriver(t)
+	if _, err := d.PutFile("/f", bytes.NewBufferString("abc"), false); err != nil {
+		t.Fatalf("PutFile: %v", err)
+	}
+	if _, err := d.PutFile("/f", bytes.NewBufferString("def"), true); err != nil {
+		t.Fatalf("PutFile append: %v", err)
+	}
+
+	_, r, err := d.GetFile("/f", 0)
+	if err != nil {
+		t.Fatalf("GetFile: %v", err)
+	}
+	defer r.Close()
+	got, _ := ioutil.ReadAll(r)
+	if string(got) != "abcdef" {
+		t.Fatalf("data = %q, want %q", got, "abcdef")
+	}
+}
+
+func TestMakeDirAndListDir(t *testing.T) {
+	d := newTestDriver(t)
+	if err := d.MakeDir("/a/b"); err != nil {
+		t.Fatalf("MakeDir: %v", err)
+	}
+	if _, err := d.PutFile("/a/b/c.txt", bytes.NewBufferString("x"), false); err != nil {
+		t.Fatalf("PutFile: %v", err)
+	}
+
+	var names []string
+	err := d.ListDir("/a/b", func(fi server.FileInfo) error {
+		names = append(names, fi.Name())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ListDir: %v", err)
+	}
+	if len(names) != 1 || names[0] != "c.txt" {
+		t.Fatalf("names = %v, want [c.txt]", names)
+	}
+
+	if err := d.ChangeDir("/a/b"); err != nil {
+		t.Fatalf("ChangeDir on directory: %v", err)
+	}
+	if err := d.ChangeDir("/a/b/c.txt"); err == nil {
+		t.Fatal("ChangeDir on a file should fail")
+	}
+}
+
+func TestRenameFile(t *testing.T) {
+	d := newTestDriver(t)
+	if _, err := d.PutFile("/src.txt", bytes.NewBufferString("x"), false); err != nil {
+		t.Fatalf("PutFile: %v", err)
+	}
+	if err := d.MakeDir("/dst"); err != nil {
+		t.Fatalf("MakeDir: %v", err)
+	}
+	if err := d.Rename("/src.txt", "/dst/dst.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := d.Stat("/src.txt"); err == nil {
+		t.Fatal("source should no longer exist after Rename")
+	}
+	if _, err := d.Stat("/dst/dst.txt"); err != nil {
+		t.Fatalf("Stat destination: %v", err)
+	}
+}
+
+func TestDeleteFileRejectsDir(t *testing.T) {
+	d := newTestDriver(t)
+	if err := d.MakeDir("/dir"); err != nil {
+		t.Fatalf("MakeDir: %v", err)
+	}
+	if err := d.DeleteFile("/dir"); err == nil {
+		t.Fatal("DeleteFile on a directory should fail")
+	}
+	if err := d.DeleteDir("/dir"); err != nil {
+		t.Fatalf("DeleteDir: %v", err)
+	}
+}
+
+func TestPutFileRejectsWhenDirectoryExists(t *testing.T) {
+	d := newTestDriver(t)
+	if err := d.MakeDir("/dir"); err != nil {
+		t.Fatalf("MakeDir: %v", err)
+	}
+	if _, err := d.PutFile("/dir", bytes.NewBufferString("x"), false); err == nil {
+		t.Fatal("PutFile onto an existing directory should fail")
+	}
+}
+
+func TestStatReportsModeAndOwner(t *testing.T) {
+	d := newTestDriver(t)
+	if _, err := d.PutFile("/a.txt", bytes.NewBufferString("x"), false); err != nil {
+		t.Fatalf("PutFile: %v", err)
+	}
+
+	info, err := d.Stat("/a.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode() != 0644 {
+		t.Fatalf("Mode = %v, want 0644", info.Mode())
+	}
+	if info.Owner() != "root" {
+		t.Fatalf("Owner = %q, want root", info.Owner())
+	}
+	if info.IsDir() {
+		t.Fatal("IsDir = true for a plain file")
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package memory implements server.Driver entirely in process memory. It is
+// meant for tests and short-lived demos where a real storage backend would
+// be overkill; nothing written to it survives a restart.
+package memory
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yunnet/chillon/server"
+)
+
+type node struct {
+	name     string
+	isDir    bool
+	data     []byte
+	modTime  time.Time
+	children map[string]*node
+}
+
+func newDir(name string) *node {
+	return &node{name: name, isDir: true, modTime: time.Now(), children: map[string]*node{}}
+}
+
+// Driver keeps the whole tree in memory, guarded by a single mutex. It is
+// not meant to scale; it exists so the server can be exercised without
+// touching disk or an object store.
+type Driver struct {
+	server.Perm
+
+	mu   sync.RWMutex
+	root *node
+}
+
+// NewDriver returns a Driver with an empty root directory.
+func NewDriver(perm server.Perm) *Driver {
+	return &Driver{Perm: perm, root: newDir("/")}
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	isDir   bool
+	mode    os.FileMode
+	modTime time.Time
+	owner   string
+	group   string
+}
+
+func (f *fileInfo) Name() string       { return f.name }
+func (f *fileInfo) Size() int64        { return f.size }
+func (f *fileInfo) Mode() os.FileMode  { return f.mode }
+func (f *fileInfo) ModTime() time.Time { return f.modTime }
+func (f *fileInfo) IsDir() bool        { return f.isDir }
+func (f *fileInfo) Sys() interface{}   { return nil }
+func (f *fileInfo) Owner() string      { return f.owner }
+func (f *fileInfo) Group() string      { return f.group }
+
+func splitPath(p string) []string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" || p == "." {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+func (d *Driver) walk(parts []string) *node {
+	cur := d.root
+	for _, p := range parts {
+		if cur.children == nil {
+			return nil
+		}
+		next, ok := cur.children[p]
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
+
+func (d *Driver) Init(conn *server.Conn) {
+	//driver.conn = conn
+}
+
+func (d *Driver) ChangeDir(p string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n := d.walk(splitPath(p))
+	if n == nil {
+		return errors.New("not found: " + p)
+	}
+	if !n.isDir {
+		return errors.New("Not a directory")
+	}
+	return nil
+}
+
+func (d *Driver) statLocked(p string) (*node, error) {
+	n := d.walk(splitPath(p))
+	if n == nil {
+		return nil, errors.New("not found: " + p)
+	}
+	return n, nil
+}
+
+func (d *Driver) Stat(p string) (server.FileInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n, err := d.statLocked(p)
+	if err != nil {
+		return nil, err
+	}
+	return d.toFileInfo(p, n)
+}
+
+func (d *Driver) toFileInfo(p string, n *node) (server.FileInfo, error) {
+	mode, err := d.Perm.GetMode(p)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := d.Perm.GetOwner(p)
+	if err != nil {
+		return nil, err
+	}
+	group, err := d.Perm.GetGroup(p)
+	if err != nil {
+		return nil, err
+	}
+	if n.isDir {
+		mode |= os.ModeDir
+	}
+	return &fileInfo{name: n.name, size: int64(len(n.data)), isDir: n.isDir, mode: mode, modTime: n.modTime, owner: owner, group: group}, nil
+}
+
+func (d *Driver) ListDir(p string, callback func(server.FileInfo) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n, err := d.statLocked(p)
+	if err != nil {
+		return err
+	}
+	if !n.isDir {
+		return errors.New("Not a directory")
+	}
+	for name, child := range n.children {
+		info, err := d.toFileInfo(path.Join(p, name), child)
+		if err != nil {
+			return err
+		}
+		if err := callback(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) DeleteDir(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	parts := splitPath(p)
+	if len(parts) == 0 {
+		return errors.New("cannot delete root")
+	}
+	parent := d.walk(parts[:len(parts)-1])
+	if parent == nil {
+		return errors.New("not found: " + p)
+	}
+	name := parts[len(parts)-1]
+	n, ok := parent.children[name]
+	if !ok {
+		return errors.New("not found: " + p)
+	}
+	if !n.isDir {
+		return errors.New("Not a directory")
+	}
+	delete(parent.children, name)
+	return nil
+}
+
+func (d *Driver) DeleteFile(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	parts := splitPath(p)
+	if len(parts) == 0 {
+		return errors.New("not found: " + p)
+	}
+	parent := d.walk(parts[:len(parts)-1])
+	if parent == nil {
+		return errors.New("not found: " + p)
+	}
+	name := parts[len(parts)-1]
+	n, ok := parent.children[name]
+	if !ok {
+		return errors.New("not found: " + p)
+	}
+	if n.isDir {
+		return errors.New("Not a file")
+	}
+	delete(parent.children, name)
+	return nil
+}
+
+func (d *Driver) Rename(fromPath string, toPath string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fromParts := splitPath(fromPath)
+	if len(fromParts) == 0 {
+		return errors.New("cannot rename root")
+	}
+	fromParent := d.walk(fromParts[:len(fromParts)-1])
+	if fromParent == nil {
+		return errors.New("not found: " + fromPath)
+	}
+	fromName := fromParts[len(fromParts)-1]
+	n, ok := fromParent.children[fromName]
+	if !ok {
+		return errors.New("not found: " + fromPath)
+	}
+
+	toParts := splitPath(toPath)
+	if len(toParts) == 0 {
+		return errors.New("invalid destination: " + toPath)
+	}
+	toParent, err := d.mkdirAllLocked(toParts[:len(toParts)-1])
+	if err != nil {
+		return err
+	}
+	toName := toParts[len(toParts)-1]
+
+	delete(fromParent.children, fromName)
+	n.name = toName
+	toParent.children[toName] = n
+	return nil
+}
+
+func (d *Driver) mkdirAllLocked(parts []string) (*node, error) {
+	cur := d.root
+	for _, p := range parts {
+		child, ok := cur.children[p]
+		if !ok {
+			child = newDir(p)
+			cur.children[p] = child
+		} else if !child.isDir {
+			return nil, errors.New("Not a directory: " + p)
+		}
+		cur = child
+	}
+	return cur, nil
+}
+
+func (d *Driver) MakeDir(p string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := d.mkdirAllLocked(splitPath(p))
+	return err
+}
+
+func (d *Driver) GetFile(p string, offset int64) (int64, io.ReadCloser, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n, err := d.statLocked(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n.isDir {
+		return 0, nil, errors.New("Not a file")
+	}
+	if offset > int64(len(n.data)) {
+		offset = int64(len(n.data))
+	}
+	return int64(len(n.data)), ioutil.NopCloser(bytes.NewReader(n.data[offset:])), nil
+}
+
+func (d *Driver) PutFile(destPath string, data io.Reader, appendData bool) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	parts := splitPath(destPath)
+	if len(parts) == 0 {
+		return 0, errors.New("invalid destination: " + destPath)
+	}
+	parent, err := d.mkdirAllLocked(parts[:len(parts)-1])
+	if err != nil {
+		return 0, err
+	}
+	name := parts[len(parts)-1]
+
+	n, isExist := parent.children[name]
+	if isExist && n.isDir {
+		return 0, errors.New("A dir has the same name")
+	}
+
+	buf, err := ioutil.ReadAll(data)
+	if err != nil {
+		return 0, err
+	}
+
+	if appendData && isExist {
+		n.data = append(n.data, buf...)
+		n.modTime = time.Now()
+		return int64(len(buf)), nil
+	}
+
+	parent.children[name] = &node{name: name, data: buf, modTime: time.Now()}
+	return int64(len(buf)), nil
+}
+
+// DriverFactory builds a new in-memory Driver for each client connection.
+// Every connection gets its own empty filesystem unless Shared is set, in
+// which case all connections see the same tree.
+type DriverFactory struct {
+	server.Perm
+
+	Shared bool
+	shared *Driver
+	once   sync.Once
+}
+
+func (f *DriverFactory) NewDriver() (server.Driver, error) {
+	if !f.Shared {
+		return NewDriver(f.Perm), nil
+	}
+	f.once.Do(func() {
+		f.shared = NewDriver(f.Perm)
+	})
+	return f.shared, nil
+}
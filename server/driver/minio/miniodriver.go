@@ -0,0 +1,351 @@
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package minio implements server.Driver on top of an S3-compatible object
+// store (AWS S3, MinIO, ...) via github.com/minio/minio-go, so the FTP
+// server can expose a bucket the same way it exposes a local directory.
+package minio
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go"
+
+	"github.com/yunnet/chillon/server"
+)
+
+// Config holds the connection details for the backing bucket.
+type Config struct {
+	Endpoint string
+	Bucket   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+}
+
+// Driver serves objects out of a single bucket of an S3-compatible store.
+// Directories don't exist natively in S3, so they are emulated with
+// zero-byte marker objects named "<prefix>/" the way most S3 FTP/SFTP
+// gateways do.
+type Driver struct {
+	server.Perm
+
+	client *minio.Client
+	bucket string
+}
+
+// NewDriver dials the configured endpoint and returns a ready-to-use Driver.
+func NewDriver(cfg Config, perm server.Perm) (*Driver, error) {
+	client, err := minio.New(cfg.Endpoint, cfg.AccessKeyID, cfg.SecretAccessKey, cfg.UseSSL)
+	if err != nil {
+		return nil, err
+	}
+	return &Driver{Perm: perm, client: client, bucket: cfg.Bucket}, nil
+}
+
+type objectInfo struct {
+	minio.ObjectInfo
+	name  string
+	isDir bool
+	mode  os.FileMode
+	owner string
+	group string
+}
+
+func (o *objectInfo) Name() string { return o.name }
+func (o *objectInfo) Size() int64 {
+	if o.isDir {
+		return 0
+	}
+	return o.ObjectInfo.Size
+}
+func (o *objectInfo) Mode() os.FileMode { return o.mode }
+func (o *objectInfo) ModTime() time.Time {
+	return o.ObjectInfo.LastModified
+}
+func (o *objectInfo) IsDir() bool      { return o.isDir }
+func (o *objectInfo) Sys() interface{} { return nil }
+func (o *objectInfo) Owner() string    { return o.owner }
+func (o *objectInfo) Group() string    { return o.group }
+
+func objectKey(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+func dirMarkerKey(path string) string {
+	key := objectKey(path)
+	if key == "" {
+		return ""
+	}
+	return strings.TrimSuffix(key, "/") + "/"
+}
+
+func (d *Driver) Init(conn *server.Conn) {
+	//driver.conn = conn
+}
+
+func (d *Driver) ChangeDir(path string) error {
+	info, err := d.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("Not a directory")
+	}
+	return nil
+}
+
+func (d *Driver) Stat(path string) (server.FileInfo, error) {
+	key := objectKey(path)
+	if key == "" {
+		return d.newInfo(path, minio.ObjectInfo{}, true)
+	}
+
+	info, err := d.client.StatObject(d.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return d.newInfo(path, info, false)
+	}
+
+	// Not a plain object; it may be a "directory" represented only by the
+	// marker object or by other objects sharing its prefix.
+	if _, err := d.client.StatObject(d.bucket, dirMarkerKey(path), minio.StatObjectOptions{}); err == nil {
+		return d.newInfo(path, minio.ObjectInfo{}, true)
+	}
+
+	// doneCh must be closed, not nil: the listing goroutine only stops
+	// early via <-doneCh, and we only want its first result. Without it,
+	// returning after the first object leaves that goroutine blocked
+	// forever trying to send the next page into a channel nobody is
+	// draining.
+	doneCh := make(chan struct{})
+	for obj := range d.client.ListObjectsV2(d.bucket, key+"/", false, doneCh) {
+		close(doneCh)
+		if obj.Err == nil {
+			return d.newInfo(path, minio.ObjectInfo{}, true)
+		}
+		break
+	}
+
+	return nil, errors.New("not found: " + path)
+}
+
+func (d *Driver) newInfo(path string, info minio.ObjectInfo, isDir bool) (server.FileInfo, error) {
+	name := path
+	if idx := strings.LastIndex(strings.TrimSuffix(path, "/"), "/"); idx >= 0 {
+		name = strings.TrimSuffix(path, "/")[idx+1:]
+	}
+
+	mode, err := d.Perm.GetMode(path)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := d.Perm.GetOwner(path)
+	if err != nil {
+		return nil, err
+	}
+	group, err := d.Perm.GetGroup(path)
+	if err != nil {
+		return nil, err
+	}
+	if isDir {
+		mode |= os.ModeDir
+	}
+	return &objectInfo{ObjectInfo: info, name: name, isDir: isDir, mode: mode, owner: owner, group: group}, nil
+}
+
+func (d *Driver) ListDir(path string, callback func(server.FileInfo) error) error {
+	prefix := objectKey(path)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	seenDirs := map[string]bool{}
+	for obj := range d.client.ListObjectsV2(d.bucket, prefix, false, nil) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+
+		rel := strings.TrimPrefix(obj.Key, prefix)
+		if rel == "" {
+			continue
+		}
+
+		if strings.HasSuffix(rel, "/") {
+			dirName := strings.TrimSuffix(rel, "/")
+			if seenDirs[dirName] {
+				continue
+			}
+			seenDirs[dirName] = true
+			info, err := d.newInfo(prefix+dirName, minio.ObjectInfo{}, true)
+			if err != nil {
+				return err
+			}
+			if err := callback(info); err != nil {
+				return err
+			}
+			continue
+		}
+
+		info, err := d.newInfo(prefix+rel, obj, false)
+		if err != nil {
+			return err
+		}
+		if err := callback(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Driver) DeleteDir(path string) error {
+	prefix := objectKey(path)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	for obj := range d.client.ListObjectsV2(d.bucket, prefix, true, nil) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if err := d.client.RemoveObject(d.bucket, obj.Key); err != nil {
+			return err
+		}
+	}
+	return d.client.RemoveObject(d.bucket, dirMarkerKey(path))
+}
+
+func (d *Driver) DeleteFile(path string) error {
+	return d.client.RemoveObject(d.bucket, objectKey(path))
+}
+
+func (d *Driver) copyKey(fromKey, toKey string) error {
+	src := minio.NewSourceInfo(d.bucket, fromKey, nil)
+	dst, err := minio.NewDestinationInfo(d.bucket, toKey, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := d.client.CopyObject(dst, src); err != nil {
+		return err
+	}
+	return d.client.RemoveObject(d.bucket, fromKey)
+}
+
+// Rename moves a single object, or - mirroring DeleteDir's walk - every
+// object under a directory's prefix, to its new key. Without the prefix
+// walk, renaming a directory would only move its marker object and orphan
+// every file underneath it.
+func (d *Driver) Rename(fromPath string, toPath string) error {
+	fromPrefix := objectKey(fromPath)
+	if fromPrefix != "" && !strings.HasSuffix(fromPrefix, "/") {
+		fromPrefix += "/"
+	}
+	toPrefix := objectKey(toPath)
+	if toPrefix != "" && !strings.HasSuffix(toPrefix, "/") {
+		toPrefix += "/"
+	}
+
+	isDir := false
+	for obj := range d.client.ListObjectsV2(d.bucket, fromPrefix, true, nil) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		isDir = true
+		if err := d.copyKey(obj.Key, toPrefix+strings.TrimPrefix(obj.Key, fromPrefix)); err != nil {
+			return err
+		}
+	}
+	if isDir {
+		if err := d.copyKey(dirMarkerKey(fromPath), dirMarkerKey(toPath)); err != nil {
+			// The directory may have no marker object of its own (only
+			// content beneath it, already moved above); that's fine.
+			if resp, ok := err.(minio.ErrorResponse); !ok || resp.Code != "NoSuchKey" {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return d.copyKey(objectKey(fromPath), objectKey(toPath))
+}
+
+func (d *Driver) MakeDir(path string) error {
+	key := dirMarkerKey(path)
+	_, err := d.client.PutObject(d.bucket, key, strings.NewReader(""), 0, minio.PutObjectOptions{})
+	return err
+}
+
+func (d *Driver) GetFile(path string, offset int64) (int64, io.ReadCloser, error) {
+	key := objectKey(path)
+	info, err := d.client.StatObject(d.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	opts := minio.GetObjectOptions{}
+	if offset > 0 {
+		if err := opts.SetRange(offset, 0); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	obj, err := d.client.GetObject(d.bucket, key, opts)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return info.Size, obj, nil
+}
+
+func (d *Driver) PutFile(destPath string, data io.Reader, appendData bool) (int64, error) {
+	key := objectKey(destPath)
+
+	if !appendData {
+		n, err := d.client.PutObject(d.bucket, key, data, -1, minio.PutObjectOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+
+	// S3 objects are immutable, so append is emulated by downloading the
+	// existing object, concatenating the new bytes, and reuploading it as
+	// a whole under the same key.
+	existing, err := d.client.GetObject(d.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	existingBytes, err := ioutil.ReadAll(existing)
+	existing.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	newBytes, err := ioutil.ReadAll(data)
+	if err != nil {
+		return 0, err
+	}
+
+	combined := append(existingBytes, newBytes...)
+	n, err := d.client.PutObject(d.bucket, key, strings.NewReader(string(combined)), int64(len(combined)), minio.PutObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return n - int64(len(existingBytes)), nil
+}
+
+// DriverFactory builds a Driver against the same bucket for every client
+// connection.
+type DriverFactory struct {
+	Config Config
+	server.Perm
+}
+
+func (f *DriverFactory) NewDriver() (server.Driver, error) {
+	return NewDriver(f.Config, f.Perm)
+}
@@ -0,0 +1,29 @@
+package minio
+
+import "testing"
+
+func TestObjectKey(t *testing.T) {
+	cases := map[string]string{
+		"/a/b.txt": "a/b.txt",
+		"a/b.txt":  "a/b.txt",
+		"/":        "",
+	}
+	for path, want := range cases {
+		if got := objectKey(path); got != want {
+			t.Errorf("objectKey(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestDirMarkerKey(t *testing.T) {
+	cases := map[string]string{
+		"/a/b":  "a/b/",
+		"/a/b/": "a/b/",
+		"/":     "",
+	}
+	for path, want := range cases {
+		if got := dirMarkerKey(path); got != want {
+			t.Errorf("dirMarkerKey(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ldbUserPrefix = "user:"
+	ldbACLPrefix  = "acl:"
+)
+
+type ldbUserRecord struct {
+	PasswordHash []byte `json:"password_hash"`
+	HomeDir      string `json:"home_dir"`
+}
+
+type ldbACLRecord struct {
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+	Mode  uint32 `json:"mode"`
+}
+
+// LDBAuth authenticates logins against users stored in a LevelDB database,
+// rather than the single hard-coded account SimpleAuth checks against. The
+// database is opened once at startup and shared with an LDBPerm for ACLs.
+type LDBAuth struct {
+	db *leveldb.DB
+}
+
+// NewLDBAuth returns an LDBAuth backed by db.
+func NewLDBAuth(db *leveldb.DB) *LDBAuth {
+	return &LDBAuth{db: db}
+}
+
+func (a *LDBAuth) getUser(name string) (*ldbUserRecord, error) {
+	raw, err := a.db.Get([]byte(ldbUserPrefix+name), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rec ldbUserRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (a *LDBAuth) CheckPasswd(name, pass string) (bool, error) {
+	rec, err := a.getUser(name)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := bcrypt.CompareHashAndPassword(rec.PasswordHash, []byte(pass)); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+// HomeDir returns the home-directory root configured for name, or "" if the
+// user has none on record.
+func (a *LDBAuth) HomeDir(name string) (string, error) {
+	rec, err := a.getUser(name)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	return rec.HomeDir, nil
+}
+
+// PutUser creates or updates a user, hashing pass with bcrypt before it is
+// stored.
+func (a *LDBAuth) PutUser(name, pass, homeDir string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(ldbUserRecord{PasswordHash: hash, HomeDir: homeDir})
+	if err != nil {
+		return err
+	}
+	return a.db.Put([]byte(ldbUserPrefix+name), raw, nil)
+}
+
+// DeleteUser removes name, if present.
+func (a *LDBAuth) DeleteUser(name string) error {
+	return a.db.Delete([]byte(ldbUserPrefix+name), nil)
+}
+
+// LDBPerm is a Perm implementation that looks up per-path owner/group/mode
+// in a LevelDB database, falling back to defaultOwner/defaultGroup/
+// defaultMode for any path without an ACL on record - the same answer
+// SimplePerm gives every path. FileDriver.Stat/ListDir need no changes to
+// use it; they already only ever talk to the Perm interface.
+type LDBPerm struct {
+	db *leveldb.DB
+
+	defaultOwner string
+	defaultGroup string
+	defaultMode  os.FileMode
+}
+
+// NewLDBPerm returns an LDBPerm backed by db, defaulting to
+// defaultOwner/defaultGroup/0755 for paths with no ACL recorded.
+func NewLDBPerm(db *leveldb.DB, defaultOwner, defaultGroup string) *LDBPerm {
+	return &LDBPerm{db: db, defaultOwner: defaultOwner, defaultGroup: defaultGroup, defaultMode: os.ModePerm}
+}
+
+func (p *LDBPerm) getACL(path string) (*ldbACLRecord, error) {
+	raw, err := p.db.Get([]byte(ldbACLPrefix+path), nil)
+	if err != nil {
+		return nil, err
+	}
+	var rec ldbACLRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (p *LDBPerm) GetMode(path string) (os.FileMode, error) {
+	rec, err := p.getACL(path)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return p.defaultMode, nil
+		}
+		return 0, err
+	}
+	return os.FileMode(rec.Mode), nil
+}
+
+func (p *LDBPerm) GetOwner(path string) (string, error) {
+	rec, err := p.getACL(path)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return p.defaultOwner, nil
+		}
+		return "", err
+	}
+	return rec.Owner, nil
+}
+
+func (p *LDBPerm) GetGroup(path string) (string, error) {
+	rec, err := p.getACL(path)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return p.defaultGroup, nil
+		}
+		return "", err
+	}
+	return rec.Group, nil
+}
+
+// SetACL records owner/group/mode for path, overriding the defaults for
+// every future Stat/ListDir lookup against it.
+func (p *LDBPerm) SetACL(path, owner, group string, mode os.FileMode) error {
+	raw, err := json.Marshal(ldbACLRecord{Owner: owner, Group: group, Mode: uint32(mode)})
+	if err != nil {
+		return err
+	}
+	return p.db.Put([]byte(ldbACLPrefix+path), raw, nil)
+}
+
+// DeleteACL removes the ACL recorded for path, if any; lookups against path
+// fall back to the defaults again.
+func (p *LDBPerm) DeleteACL(path string) error {
+	return p.db.Delete([]byte(ldbACLPrefix+path), nil)
+}
+
+// MigrateFromSimplePerm seeds ldb's defaults from an existing SimplePerm,
+// using its answers for "/" so switching a running deployment over doesn't
+// change anyone's owner/group/mode until an operator starts recording
+// per-path ACLs of their own.
+func MigrateFromSimplePerm(simple *SimplePerm, ldb *LDBPerm) error {
+	owner, err := simple.GetOwner("/")
+	if err != nil {
+		return err
+	}
+	group, err := simple.GetGroup("/")
+	if err != nil {
+		return err
+	}
+	mode, err := simple.GetMode("/")
+	if err != nil {
+		return err
+	}
+	ldb.defaultOwner = owner
+	ldb.defaultGroup = group
+	ldb.defaultMode = mode
+	return nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func newTestLDB(t *testing.T) *leveldb.DB {
+	t.Helper()
+	db, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		t.Fatalf("leveldb.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLDBAuthCheckPasswd(t *testing.T) {
+	auth := NewLDBAuth(newTestLDB(t))
+	if err := auth.PutUser("alice", "hunter2", "/alice"); err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+
+	if ok, err := auth.CheckPasswd("alice", "hunter2"); err != nil || !ok {
+		t.Fatalf("CheckPasswd(correct) = %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := auth.CheckPasswd("alice", "wrong"); err != nil || ok {
+		t.Fatalf("CheckPasswd(wrong) = %v, %v, want false, nil", ok, err)
+	}
+	if ok, err := auth.CheckPasswd("nobody", "anything"); err != nil || ok {
+		t.Fatalf("CheckPasswd(unknown user) = %v, %v, want false, nil", ok, err)
+	}
+}
+
+func TestLDBAuthDeleteUser(t *testing.T) {
+	auth := NewLDBAuth(newTestLDB(t))
+	if err := auth.PutUser("alice", "hunter2", "/alice"); err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+
+	if err := auth.DeleteUser("alice"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	if ok, err := auth.CheckPasswd("alice", "hunter2"); err != nil || ok {
+		t.Fatalf("CheckPasswd after DeleteUser = %v, %v, want false, nil", ok, err)
+	}
+	if home, err := auth.HomeDir("alice"); err != nil || home != "" {
+		t.Fatalf("HomeDir after DeleteUser = %q, %v, want \"\", nil", home, err)
+	}
+}
+
+func TestLDBPermDefaultsWithNoACL(t *testing.T) {
+	p := NewLDBPerm(newTestLDB(t), "root", "wheel")
+
+	if owner, err := p.GetOwner("/anything"); err != nil || owner != "root" {
+		t.Fatalf("GetOwner = %q, %v, want root, nil", owner, err)
+	}
+	if group, err := p.GetGroup("/anything"); err != nil || group != "wheel" {
+		t.Fatalf("GetGroup = %q, %v, want wheel, nil", group, err)
+	}
+	if mode, err := p.GetMode("/anything"); err != nil || mode != os.ModePerm {
+		t.Fatalf("GetMode = %v, %v, want %v, nil", mode, err, os.ModePerm)
+	}
+}
+
+func TestLDBPermSetACLOverridesDefaults(t *testing.T) {
+	p := NewLDBPerm(newTestLDB(t), "root", "wheel")
+
+	if err := p.SetACL("/alice", "alice", "alice", 0640); err != nil {
+		t.Fatalf("SetACL: %v", err)
+	}
+
+	if owner, err := p.GetOwner("/alice"); err != nil || owner != "alice" {
+		t.Fatalf("GetOwner = %q, %v, want alice, nil", owner, err)
+	}
+	if group, err := p.GetGroup("/alice"); err != nil || group != "alice" {
+		t.Fatalf("GetGroup = %q, %v, want alice, nil", group, err)
+	}
+	if mode, err := p.GetMode("/alice"); err != nil || mode != 0640 {
+		t.Fatalf("GetMode = %v, %v, want 0640, nil", mode, err)
+	}
+
+	// A different path is untouched by the ACL set above.
+	if owner, err := p.GetOwner("/bob"); err != nil || owner != "root" {
+		t.Fatalf("GetOwner(/bob) = %q, %v, want root, nil", owner, err)
+	}
+}
+
+func TestLDBPermDeleteACLFallsBackToDefaults(t *testing.T) {
+	p := NewLDBPerm(newTestLDB(t), "root", "wheel")
+	if err := p.SetACL("/alice", "alice", "alice", 0640); err != nil {
+		t.Fatalf("SetACL: %v", err)
+	}
+
+	if err := p.DeleteACL("/alice"); err != nil {
+		t.Fatalf("DeleteACL: %v", err)
+	}
+
+	if owner, err := p.GetOwner("/alice"); err != nil || owner != "root" {
+		t.Fatalf("GetOwner after DeleteACL = %q, %v, want root, nil", owner, err)
+	}
+	if mode, err := p.GetMode("/alice"); err != nil || mode != os.ModePerm {
+		t.Fatalf("GetMode after DeleteACL = %v, %v, want %v, nil", mode, err, os.ModePerm)
+	}
+}
+
+// MigrateFromSimplePerm isn't covered here: it takes a *SimplePerm, and
+// SimplePerm isn't defined anywhere in this tree (it would live in the
+// perm.go this snapshot is missing), so no value of that type can be
+// constructed to call it with.
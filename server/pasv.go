@@ -0,0 +1,171 @@
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPasvAcquireTimeout bounds how long a PASV/EPSV command waits for a
+// free port out of ServerOpts.PassivePorts before giving up.
+const defaultPasvAcquireTimeout = 5 * time.Second
+
+// ErrPassivePortsExhausted is returned by Server.PasvListen when every port
+// in ServerOpts.PassivePorts is already in use and none frees up before the
+// acquisition timeout.
+var ErrPassivePortsExhausted = errors.New("ftp: no free passive port available")
+
+// pasvPortPool hands out listening ports from an inclusive range, fairly
+// (round-robin) and with bounded wait, so that a PASV/EPSV command against
+// an exhausted range fails cleanly instead of hanging forever.
+type pasvPortPool struct {
+	min, max int
+
+	mu     sync.Mutex
+	cursor int
+	inUse  map[int]bool
+	free   chan struct{}
+}
+
+func parsePassivePorts(s string) (min, max int, err error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("ftp: invalid PassivePorts %q, want \"min-max\"", s)
+	}
+	min, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("ftp: invalid PassivePorts %q: %v", s, err)
+	}
+	max, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("ftp: invalid PassivePorts %q: %v", s, err)
+	}
+	if min <= 0 || max < min {
+		return 0, 0, fmt.Errorf("ftp: invalid PassivePorts %q, want 1 <= min <= max", s)
+	}
+	return min, max, nil
+}
+
+// newPasvPortPool builds a pool over the inclusive range described by
+// rangeStr, e.g. "30000-32000".
+func newPasvPortPool(rangeStr string) (*pasvPortPool, error) {
+	min, max, err := parsePassivePorts(rangeStr)
+	if err != nil {
+		return nil, err
+	}
+	// free is sized to the range and kept topped up with one token per idle
+	// port, so Acquire can block on it instead of busy-polling inUse.
+	p := &pasvPortPool{min: min, max: max, inUse: map[int]bool{}, free: make(chan struct{}, max-min+1)}
+	for i := min; i <= max; i++ {
+		p.free <- struct{}{}
+	}
+	return p, nil
+}
+
+// acquirePort reserves the next free port in round-robin order. Callers
+// must release it (via the listener returned by listen, or explicitly on
+// failure to bind) once they're done.
+func (p *pasvPortPool) acquirePort() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i <= p.max-p.min; i++ {
+		port := p.min + (p.cursor+i)%(p.max-p.min+1)
+		if !p.inUse[port] {
+			p.inUse[port] = true
+			p.cursor = (p.cursor + i + 1) % (p.max - p.min + 1)
+			return port
+		}
+	}
+	panic("pasvPortPool: acquirePort called with no free port reserved")
+}
+
+func (p *pasvPortPool) release(port int) {
+	p.mu.Lock()
+	delete(p.inUse, port)
+	p.mu.Unlock()
+	p.free <- struct{}{}
+}
+
+// Acquire binds and returns a listener on a free port from the pool,
+// waiting up to timeout for one to become available.
+func (p *pasvPortPool) Acquire(timeout time.Duration) (net.Listener, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	select {
+	case <-p.free:
+	case <-ctx.Done():
+		return nil, ErrPassivePortsExhausted
+	}
+
+	port := p.acquirePort()
+	ln, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		p.release(port)
+		return nil, err
+	}
+	return &pasvListener{Listener: ln, pool: p, port: port}, nil
+}
+
+// pasvListener releases its port back to the pool on Close, so the next
+// PASV/EPSV command can reuse it.
+type pasvListener struct {
+	net.Listener
+	pool     *pasvPortPool
+	port     int
+	released bool
+	mu       sync.Mutex
+}
+
+func (l *pasvListener) Close() error {
+	err := l.Listener.Close()
+	l.mu.Lock()
+	if !l.released {
+		l.released = true
+		l.pool.release(l.port)
+	}
+	l.mu.Unlock()
+	return err
+}
+
+// PasvListen opens a listener for a PASV/EPSV data connection. When
+// ServerOpts.PassivePorts is configured the listener is bound to a port
+// reserved from that range (and the port is returned to the pool once the
+// listener is closed); otherwise the OS picks an ephemeral port the way it
+// always has. It's meant to be called from a PASV/EPSV command handler,
+// together with PasvAdvertiseHost for the address to put in the 227/229
+// reply - that command dispatch isn't part of this package.
+func (s *Server) PasvListen() (net.Listener, error) {
+	if s.pasvPool == nil {
+		return net.Listen("tcp", net.JoinHostPort("", "0"))
+	}
+	timeout := s.ServerOpts.PasvAcquireTimeout
+	if timeout <= 0 {
+		timeout = defaultPasvAcquireTimeout
+	}
+	return s.pasvPool.Acquire(timeout)
+}
+
+// PasvAdvertiseHost returns the address PASV/EPSV replies should advertise
+// for data connections: ServerOpts.PublicIp when set (the NAT/Docker case
+// where the server's bind address isn't reachable from outside), otherwise
+// the server's own listening host.
+func (s *Server) PasvAdvertiseHost() string {
+	if s.ServerOpts.PublicIp != "" {
+		return s.ServerOpts.PublicIp
+	}
+	host, _, err := net.SplitHostPort(s.listenTo)
+	if err != nil || host == "" || host == "::" {
+		return "127.0.0.1"
+	}
+	return host
+}
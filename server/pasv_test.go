@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePassivePorts(t *testing.T) {
+	if min, max, err := parsePassivePorts("30000-30002"); err != nil || min != 30000 || max != 30002 {
+		t.Fatalf("parsePassivePorts = %d, %d, %v", min, max, err)
+	}
+	for _, bad := range []string{"", "30000", "30002-30000", "x-30002", "30000-x"} {
+		if _, _, err := parsePassivePorts(bad); err == nil {
+			t.Errorf("parsePassivePorts(%q) = nil error, want one", bad)
+		}
+	}
+}
+
+func TestPasvPortPoolRoundRobinAndRelease(t *testing.T) {
+	p, err := newPasvPortPool("40000-40001")
+	if err != nil {
+		t.Fatalf("newPasvPortPool: %v", err)
+	}
+
+	a := p.acquirePort()
+	b := p.acquirePort()
+	if a == b {
+		t.Fatalf("acquirePort returned the same port twice: %d", a)
+	}
+	if a != 40000 || b != 40001 {
+		t.Fatalf("acquirePort = %d, %d, want 40000, 40001 in round-robin order", a, b)
+	}
+
+	p.release(a)
+	c := p.acquirePort()
+	if c != a {
+		t.Fatalf("acquirePort after release = %d, want reused port %d", c, a)
+	}
+}
+
+func TestPasvPortPoolAcquireExhaustedTimesOut(t *testing.T) {
+	p, err := newPasvPortPool("41000-41000")
+	if err != nil {
+		t.Fatalf("newPasvPortPool: %v", err)
+	}
+
+	ln, err := p.Acquire(time.Second)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	if _, err := p.Acquire(20 * time.Millisecond); err != ErrPassivePortsExhausted {
+		t.Fatalf("Acquire on exhausted pool = %v, want ErrPassivePortsExhausted", err)
+	}
+
+	if err := ln.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	ln2, err := p.Acquire(time.Second)
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	ln2.Close()
+}
+
+func TestPasvAdvertiseHost(t *testing.T) {
+	s := &Server{ServerOpts: &ServerOpts{PublicIp: "203.0.113.9"}}
+	if got := s.PasvAdvertiseHost(); got != "203.0.113.9" {
+		t.Fatalf("PasvAdvertiseHost = %q, want PublicIp", got)
+	}
+
+	s = &Server{ServerOpts: &ServerOpts{}}
+	s.listenTo = "192.168.1.5:2121"
+	if got := s.PasvAdvertiseHost(); got != "192.168.1.5" {
+		t.Fatalf("PasvAdvertiseHost = %q, want 192.168.1.5", got)
+	}
+}
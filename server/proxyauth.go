@@ -0,0 +1,302 @@
+// Copyright 2018 The goftp Authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ErrNotAuthenticated is returned by a Driver obtained from
+// ProxyDriverFactory before the owning connection has completed PASS and
+// had its backend resolved.
+var ErrNotAuthenticated = errors.New("ftp: not authenticated")
+
+// BackendDescriptor describes which backend a Proxy wants a given login
+// mounted against, e.g. {"type":"file","root":"/srv/u/alice"} or
+// {"type":"minio","bucket":"alice-bucket"}. ProxyDriverFactory.Build turns
+// one of these into a Driver.
+type BackendDescriptor struct {
+	Type string `json:"type"`
+
+	// Root is the filesystem path to mount for a "file" backend.
+	Root string `json:"root,omitempty"`
+
+	// Bucket/Endpoint/AccessKeyID/SecretAccessKey describe an object-store
+	// backend such as "minio".
+	Bucket          string `json:"bucket,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+}
+
+// Proxy resolves a USER/PASS pair to the BackendDescriptor that should back
+// that session. Implementations may call out to an external program, an
+// HTTP endpoint, or anything else; users can also embed the lookup
+// in-process by implementing Proxy directly.
+type Proxy interface {
+	Lookup(user, pass string) (*BackendDescriptor, error)
+}
+
+// ExecProxy resolves logins by invoking an external program with the
+// username and password as arguments and parsing a BackendDescriptor from
+// its stdout.
+type ExecProxy struct {
+	// Path to the program to run.
+	Path string
+
+	// Args are passed to the program before the user and password, e.g.
+	// []string{"--config", "/etc/chillon/proxy.conf"}.
+	Args []string
+}
+
+func (p *ExecProxy) Lookup(user, pass string) (*BackendDescriptor, error) {
+	args := append(append([]string{}, p.Args...), user, pass)
+	out, err := exec.Command(p.Path, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("proxyauth: exec %s: %v", p.Path, err)
+	}
+
+	var desc BackendDescriptor
+	if err := json.Unmarshal(out, &desc); err != nil {
+		return nil, fmt.Errorf("proxyauth: parsing %s output: %v", p.Path, err)
+	}
+	return &desc, nil
+}
+
+// HTTPProxy resolves logins by POSTing the username and password as JSON to
+// URL and parsing a BackendDescriptor from the JSON response body.
+type HTTPProxy struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *HTTPProxy) Lookup(user, pass string) (*BackendDescriptor, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	body, err := json.Marshal(struct {
+		User string `json:"user"`
+		Pass string `json:"pass"`
+	}{user, pass})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Post(p.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("proxyauth: POST %s: %v", p.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxyauth: POST %s: status %s", p.URL, resp.Status)
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var desc BackendDescriptor
+	if err := json.Unmarshal(respBody, &desc); err != nil {
+		return nil, fmt.Errorf("proxyauth: parsing response from %s: %v", p.URL, err)
+	}
+	return &desc, nil
+}
+
+type cacheEntry struct {
+	desc      *BackendDescriptor
+	expiresAt time.Time
+}
+
+// CachingProxy wraps a Proxy and remembers descriptors it has already
+// resolved for TTL, so that reconnecting clients don't re-trigger the
+// external lookup on every PASS.
+type CachingProxy struct {
+	Proxy Proxy
+	TTL   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCachingProxy returns a CachingProxy that caches descriptors from proxy
+// for ttl.
+func NewCachingProxy(proxy Proxy, ttl time.Duration) *CachingProxy {
+	return &CachingProxy{Proxy: proxy, TTL: ttl, entries: map[string]cacheEntry{}}
+}
+
+func (c *CachingProxy) Lookup(user, pass string) (*BackendDescriptor, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[user]; ok && time.Now().Before(entry.expiresAt) {
+		c.mu.Unlock()
+		return entry.desc, nil
+	}
+	c.mu.Unlock()
+
+	desc, err := c.Proxy.Lookup(user, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[user] = cacheEntry{desc: desc, expiresAt: time.Now().Add(c.TTL)}
+	c.mu.Unlock()
+
+	return desc, nil
+}
+
+// ProxyDriverFactory builds a Driver per login instead of serving every
+// connection out of one global Factory: on PASS, Resolve asks Proxy which
+// backend the user belongs to and hands the resulting BackendDescriptor to
+// Build to construct the Driver for that session. This lets one FTP
+// endpoint multiplex many isolated users against different storage roots.
+//
+// ProxyDriverFactory lives in the server package but deliberately doesn't
+// import the driver/* packages itself (they import server, for the Driver
+// and Perm types, so it would be a cycle) - callers inject Build with
+// whichever drivers they've linked in.
+type ProxyDriverFactory struct {
+	Proxy Proxy
+	Build func(desc *BackendDescriptor) (Driver, error)
+}
+
+// NewDriver implements DriverFactory. It hands back a pendingDriver that
+// rejects every operation until Resolve replaces it with the real backend;
+// Server.newConn wires this up so Conn.driver is swapped out once PASS
+// succeeds.
+func (f *ProxyDriverFactory) NewDriver() (Driver, error) {
+	return &pendingDriver{}, nil
+}
+
+// Resolve looks up which backend user should be mounted against and builds
+// a Driver for it. It is called from the PASS handler with the connection's
+// submitted credentials.
+func (f *ProxyDriverFactory) Resolve(user, pass string) (Driver, error) {
+	desc, err := f.Proxy.Lookup(user, pass)
+	if err != nil {
+		return nil, err
+	}
+	return f.Build(desc)
+}
+
+// pendingDriver is the placeholder Driver a Conn holds between accept and a
+// successful PASS against a ProxyDriverFactory.
+type pendingDriver struct{}
+
+func (d *pendingDriver) Init(conn *Conn) {}
+
+func (d *pendingDriver) ChangeDir(path string) error { return ErrNotAuthenticated }
+
+func (d *pendingDriver) Stat(path string) (FileInfo, error) { return nil, ErrNotAuthenticated }
+
+func (d *pendingDriver) ListDir(path string, callback func(FileInfo) error) error {
+	return ErrNotAuthenticated
+}
+
+func (d *pendingDriver) DeleteDir(path string) error { return ErrNotAuthenticated }
+
+func (d *pendingDriver) DeleteFile(path string) error { return ErrNotAuthenticated }
+
+func (d *pendingDriver) Rename(fromPath string, toPath string) error { return ErrNotAuthenticated }
+
+func (d *pendingDriver) MakeDir(path string) error { return ErrNotAuthenticated }
+
+func (d *pendingDriver) GetFile(path string, offset int64) (int64, io.ReadCloser, error) {
+	return 0, nil, ErrNotAuthenticated
+}
+
+func (d *pendingDriver) PutFile(destPath string, data io.Reader, appendData bool) (int64, error) {
+	return 0, ErrNotAuthenticated
+}
+
+// SetDriver swaps conn's active driver. It's meant to be called once a
+// ProxyDriverFactory has resolved which backend the session's user should
+// be mounted against - see ProxyAuth.
+func (c *Conn) SetDriver(d Driver) {
+	c.driver = d
+}
+
+// defaultProxyAuthTTL bounds how long a resolved Driver waits in ProxyAuth
+// to be claimed via Take before it's discarded.
+const defaultProxyAuthTTL = 10 * time.Second
+
+// ProxyAuth adapts a ProxyDriverFactory into an Auth: a successful
+// CheckPasswd both authenticates the login and resolves the Driver it
+// should use for the rest of the session.
+//
+// NOT YET ENFORCED: wiring a ProxyAuth in as ServerOpts.Auth resolves and
+// holds a Driver per login, but nothing in this session actually swaps it
+// onto the Conn. This package has no command dispatcher of its own (PASS
+// handling isn't part of this tree), so ProxyAuth can't call Conn.SetDriver
+// itself once CheckPasswd returns. Instead it holds the resolved Driver for
+// TTL so that whatever runs the PASS handler can retrieve it with Take
+// right after CheckPasswd succeeds and pass it to Conn.SetDriver.
+type ProxyAuth struct {
+	Factory *ProxyDriverFactory
+	TTL     time.Duration
+
+	mu      sync.Mutex
+	pending map[string]proxyAuthResolution
+}
+
+type proxyAuthResolution struct {
+	driver    Driver
+	expiresAt time.Time
+}
+
+// CheckPasswd implements Auth. It authenticates name/pass by resolving a
+// backend for them via Factory; failure to resolve a backend is treated as
+// a failed login rather than an error, matching how password mismatches
+// are reported by other Auth implementations.
+func (a *ProxyAuth) CheckPasswd(name, pass string) (bool, error) {
+	driver, err := a.Factory.Resolve(name, pass)
+	if err != nil {
+		return false, nil
+	}
+
+	ttl := a.TTL
+	if ttl == 0 {
+		ttl = defaultProxyAuthTTL
+	}
+
+	a.mu.Lock()
+	if a.pending == nil {
+		a.pending = map[string]proxyAuthResolution{}
+	}
+	a.pending[name] = proxyAuthResolution{driver: driver, expiresAt: time.Now().Add(ttl)}
+	a.mu.Unlock()
+
+	return true, nil
+}
+
+// Take returns and forgets the Driver ProxyAuth resolved for name's most
+// recent successful CheckPasswd. It reports false if there's no resolution
+// pending for name or it has sat unclaimed past TTL.
+func (a *ProxyAuth) Take(name string) (Driver, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.pending[name]
+	if !ok {
+		return nil, false
+	}
+	delete(a.pending, name)
+	if time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.driver, true
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type stubProxy struct {
+	desc *BackendDescriptor
+	err  error
+}
+
+func (p *stubProxy) Lookup(user, pass string) (*BackendDescriptor, error) {
+	return p.desc, p.err
+}
+
+type stubDriver struct{ pendingDriver }
+
+func TestProxyAuthCheckPasswdThenTake(t *testing.T) {
+	want := &stubDriver{}
+	factory := &ProxyDriverFactory{
+		Proxy: &stubProxy{desc: &BackendDescriptor{Type: "memory"}},
+		Build: func(desc *BackendDescriptor) (Driver, error) { return want, nil },
+	}
+	auth := &ProxyAuth{Factory: factory}
+
+	ok, err := auth.CheckPasswd("alice", "secret")
+	if err != nil {
+		t.Fatalf("CheckPasswd: %v", err)
+	}
+	if !ok {
+		t.Fatal("CheckPasswd = false, want true")
+	}
+
+	got, ok := auth.Take("alice")
+	if !ok {
+		t.Fatal("Take = false, want true")
+	}
+	if got != want {
+		t.Fatalf("Take returned %v, want %v", got, want)
+	}
+
+	if _, ok := auth.Take("alice"); ok {
+		t.Fatal("Take after claiming should report false")
+	}
+}
+
+func TestProxyAuthCheckPasswdResolveFailure(t *testing.T) {
+	factory := &ProxyDriverFactory{
+		Proxy: &stubProxy{err: errors.New("no such user")},
+	}
+	auth := &ProxyAuth{Factory: factory}
+
+	ok, err := auth.CheckPasswd("bob", "wrong")
+	if err != nil {
+		t.Fatalf("CheckPasswd: %v", err)
+	}
+	if ok {
+		t.Fatal("CheckPasswd = true, want false on resolve failure")
+	}
+}
+
+func TestProxyAuthTakeExpires(t *testing.T) {
+	factory := &ProxyDriverFactory{
+		Proxy: &stubProxy{desc: &BackendDescriptor{Type: "memory"}},
+		Build: func(desc *BackendDescriptor) (Driver, error) { return &stubDriver{}, nil },
+	}
+	auth := &ProxyAuth{Factory: factory, TTL: time.Millisecond}
+
+	if ok, err := auth.CheckPasswd("alice", "secret"); err != nil || !ok {
+		t.Fatalf("CheckPasswd = %v, %v", ok, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := auth.Take("alice"); ok {
+		t.Fatal("Take should report false once TTL has elapsed")
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 )
 
 // ServerOpts contains parameters for server.NewServer()
@@ -32,9 +34,35 @@ type ServerOpts struct {
 	// Public IP of the server
 	PublicIp string
 
-	// Passive ports
+	// Passive ports, as an inclusive range such as "30000-32000". Optional;
+	// if empty, PASV/EPSV data connections bind to an OS-assigned port.
+	//
+	// NOT YET ENFORCED: nothing in this package calls Server.PasvListen, so
+	// setting PassivePorts has no effect on an actual FTP session today.
+	// Wiring it up is the job of a PASV/EPSV command handler, which isn't
+	// part of this tree.
 	PassivePorts string
 
+	// How long a PASV/EPSV command waits for a free port out of
+	// PassivePorts before failing. Optional, defaults to 5 seconds. Subject
+	// to the same NOT YET ENFORCED caveat as PassivePorts.
+	PasvAcquireTimeout time.Duration
+
+	// BwLimit caps every session's combined upload+download rate, in
+	// bytes/sec. Optional, 0 means unlimited. A Driver can override this
+	// per session by implementing BwLimiter.
+	//
+	// NOT YET ENFORCED: nothing in this package calls Conn.WrapUpload or
+	// Conn.WrapDownload, so setting BwLimit has no effect on an actual
+	// transfer today. Wiring it up is the job of the RETR/STOR command
+	// handlers, which aren't part of this tree.
+	BwLimit int64
+
+	// How long Shutdown waits for in-flight transfers to finish once a
+	// shutdown has been requested, if the context it's given has no
+	// deadline of its own. Optional, defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+
 	// The port that the FTP should listen on. Optional, defaults to 3000. In
 	// a production environment you will probably want to change this to 21.
 	Port int
@@ -70,8 +98,25 @@ type Server struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 	feats     string
+	pasvPool  *pasvPortPool
+	bwAccMu   sync.Mutex
+	bwAcc     map[string]*accounting
+
+	connMu sync.Mutex
+	conns  map[*Conn]struct{}
+	connWG sync.WaitGroup
 }
 
+// defaultShutdownTimeout is used by Shutdown when its context has no
+// deadline and ServerOpts.ShutdownTimeout wasn't set.
+const defaultShutdownTimeout = 30 * time.Second
+
+// forceCloseDrainGrace bounds how long Shutdown waits for connWG after
+// force-closing every live socket, so a transfer wedged on something other
+// than the socket (e.g. a hung backend call) can't hold Shutdown open past
+// the caller's ctx.
+const forceCloseDrainGrace = 2 * time.Second
+
 // ErrServerClosed is returned by ListenAndServe() or Serve() when a shutdown
 // was requested.
 var ErrServerClosed = errors.New("ftp: Server closed")
@@ -125,6 +170,9 @@ func serverOptsWithDefaults(opts *ServerOpts) *ServerOpts {
 
 	newOpts.PublicIp = opts.PublicIp
 	newOpts.PassivePorts = opts.PassivePorts
+	newOpts.PasvAcquireTimeout = opts.PasvAcquireTimeout
+	newOpts.BwLimit = opts.BwLimit
+	newOpts.ShutdownTimeout = opts.ShutdownTimeout
 
 	return &newOpts
 }
@@ -173,9 +221,37 @@ func (s *Server) newConn(tcpConn net.Conn, driver Driver) *Conn {
 	conn.tlsConfig = s.tlsConfig
 
 	driver.Init(conn)
+
+	s.connMu.Lock()
+	if s.conns == nil {
+		s.conns = map[*Conn]struct{}{}
+	}
+	s.conns[conn] = struct{}{}
+	s.connMu.Unlock()
+	s.connWG.Add(1)
+
 	return conn
 }
 
+// untrackConn drops conn from the live-connection set and releases its slot
+// in connWG, so Shutdown's drain can see the connection is gone. It's
+// called once Conn.Serve returns, however it returns.
+func (s *Server) untrackConn(conn *Conn) {
+	s.connMu.Lock()
+	delete(s.conns, conn)
+	s.connMu.Unlock()
+	s.endAccounting(conn.sessionID)
+	s.connWG.Done()
+}
+
+// notifyShutdown tells conn the server is shutting down by sending it the
+// standard 421 reply, so a well-behaved client knows to stop issuing new
+// commands and disconnect on its own.
+func (c *Conn) notifyShutdown() {
+	c.controlWriter.WriteString("421 Service closing control connection\r\n")
+	c.controlWriter.Flush()
+}
+
 func (s *Server)doLogger(sessionId string, format string, v ...interface{})  {
 	s.logger.Printf(sessionId, format, v ...)
 }
@@ -230,6 +306,13 @@ func (s *Server) ListenAndServe() error {
 	}
 	s.feats = fmt.Sprintf(feats, curFeats)
 
+	if s.ServerOpts.PassivePorts != "" {
+		s.pasvPool, err = newPasvPortPool(s.ServerOpts.PassivePorts)
+		if err != nil {
+			return err
+		}
+	}
+
 	s.doLogger("", "%s listening on %d", s.Name, s.Port)
 
 	return s.Serve(listener)
@@ -256,19 +339,107 @@ func (s *Server) Serve(l net.Listener) error {
 			}
 			return err
 		}
+		// A ProxyDriverFactory can't build the real Driver until PASS
+		// reveals which user is logging in, so NewDriver hands back a
+		// pendingDriver here that rejects every operation with
+		// ErrNotAuthenticated. Pairing the factory with a ProxyAuth and
+		// calling Conn.SetDriver once its Take resolves is up to whatever
+		// runs the PASS handler.
 		driver, err := s.Factory.NewDriver()
 		if err != nil {
 			s.logger.Printf(sessionID, "Error creating driver, aborting client connection: %v", err)
 			tcpConn.Close()
 		} else {
 			ftpConn := s.newConn(tcpConn, driver)
-			go ftpConn.Serve()
+			go func() {
+				defer s.untrackConn(ftpConn)
+				ftpConn.Serve()
+			}()
 		}
 	}
 }
 
-// Shutdown will gracefully stop a server. Already connected clients will retain their connections
-func (s *Server) Shutdown() error {
+// Shutdown gracefully stops the server: it stops accepting new connections,
+// sends a 421 reply to every already-connected client, then waits for
+// in-flight PutFile/GetFile transfers to finish before forcing any
+// remaining sockets closed.
+//
+// If ctx carries its own deadline that deadline is honored as-is; otherwise
+// Shutdown waits up to ServerOpts.ShutdownTimeout (default 30s). Tie ctx to
+// your own SIGTERM handling to bound shutdown by however long your process
+// is given to exit cleanly. Once ctx is done, Shutdown force-closes every
+// live socket and gives connWG a further forceCloseDrainGrace to settle
+// before returning regardless, so a transfer wedged on something other than
+// the socket (a hung backend call with no deadline of its own) can't hold
+// Shutdown open past ctx.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := s.ServerOpts.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	var closeErr error
+	if s.listener != nil {
+		closeErr = s.listener.Close()
+	}
+
+	s.connMu.Lock()
+	conns := make([]*Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.connMu.Unlock()
+
+	for _, c := range conns {
+		c.notifyShutdown()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.connWG.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return closeErr
+	case <-ctx.Done():
+	}
+
+	s.connMu.Lock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.connMu.Unlock()
+
+	// Closing c.conn only unblocks a goroutine waiting on the control or
+	// data socket; a transfer stuck in a Driver call with no deadline of
+	// its own (a hung backend, say) won't notice. Give the drain a second,
+	// short chance to finish and then give up instead of blocking forever
+	// past the caller's ctx.
+	select {
+	case <-drained:
+	case <-time.After(forceCloseDrainGrace):
+	}
+	return closeErr
+}
+
+// ShutdownImmediate reproduces the behavior Shutdown() used to have before
+// it learned to drain in-flight transfers: it stops accepting new
+// connections but leaves already-connected clients to run until their next
+// I/O error.
+//
+// Deprecated: use Shutdown(ctx context.Context) instead.
+func (s *Server) ShutdownImmediate() error {
 	if s.cancel != nil {
 		s.cancel()
 	}